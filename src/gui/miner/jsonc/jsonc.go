@@ -0,0 +1,138 @@
+// Package jsonc provides a minimal round-trip-capable reader for the
+// commented, unbraced JSON variant xmr-stak uses for cpu.txt, amd.txt,
+// nvidia.txt and pools.txt. encoding/json can't parse these files directly
+// because they're a bare sequence of top-level keys wrapped in /* */ and //
+// comments, so we strip the comments (respecting string literals and
+// escapes) and wrap the result in {} before handing it to encoding/json.
+package jsonc
+
+import "encoding/json"
+
+// Strip removes // and /* */ comments from data, leaving everything inside
+// string literals untouched so thread config values like asm strings or
+// pool addresses can't be corrupted by a stray / or *
+func Strip(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+
+	var inString bool
+	var escaped bool
+	var inLineComment bool
+	var inBlockComment bool
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		var next byte
+		if i+1 < len(data) {
+			next = data[i+1]
+		}
+
+		if inLineComment {
+			if c == '\n' {
+				inLineComment = false
+				out = append(out, c)
+			}
+			continue
+		}
+
+		if inBlockComment {
+			if c == '*' && next == '/' {
+				inBlockComment = false
+				i++
+			}
+			continue
+		}
+
+		if inString {
+			out = append(out, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			out = append(out, c)
+			continue
+		}
+
+		if c == '/' && next == '/' {
+			inLineComment = true
+			i++
+			continue
+		}
+
+		if c == '/' && next == '*' {
+			inBlockComment = true
+			i++
+			continue
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// trimTrailingCommas drops the dangling comma xmr-stak leaves before a
+// closing } or ] (the whole point of writing this format by hand), which
+// encoding/json rejects outright
+func trimTrailingCommas(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	var inString bool
+	var escaped bool
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out = append(out, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			out = append(out, c)
+			continue
+		}
+
+		if c == ',' {
+			// Look ahead past whitespace for the next significant byte
+			j := i + 1
+			for j < len(data) && (data[j] == ' ' || data[j] == '\t' || data[j] == '\n' || data[j] == '\r') {
+				j++
+			}
+			if j < len(data) && (data[j] == '}' || data[j] == ']') {
+				continue
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// Unmarshal strips comments from data, wraps it in {} so the bare top-level
+// keys become a valid JSON object, and decodes the result into v
+func Unmarshal(data []byte, v interface{}) error {
+	stripped := Strip(data)
+
+	wrapped := make([]byte, 0, len(stripped)+2)
+	wrapped = append(wrapped, '{')
+	wrapped = append(wrapped, stripped...)
+	wrapped = append(wrapped, '}')
+
+	return json.Unmarshal(trimTrailingCommas(wrapped), v)
+}
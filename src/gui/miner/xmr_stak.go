@@ -1,15 +1,23 @@
 package miner
 
 import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/PabloB07/BLOC-GUI-Miner/src/gui/miner/jsonc"
 )
 
 // XmrStak implements the miner interface for the xmr-stak miner
@@ -20,6 +28,119 @@ type XmrStak struct {
 	endpoint         string
 	lastHashrate     float64
 	resultStatsCache XmrStakResponse
+	amdDevices       []GPUDevice
+	nvidiaDevices    []GPUDevice
+	supportsGPU      bool
+	httpPort         int
+	httpLogin        string
+	httpPassword     string
+	digest           *digestChallenge
+}
+
+// digestChallenge caches the WWW-Authenticate challenge xmr-stak's httpd
+// issues on the first request, so subsequent polls can skip the extra
+// round trip and go straight to an authenticated request
+type digestChallenge struct {
+	realm string
+	nonce string
+	qop   string
+	nc    int
+}
+
+// GPUDevice represents a single OpenCL/CUDA device as configured in
+// amd.txt/nvidia.txt. xmr-stak suggests a basic configuration on first run,
+// we mirror the same auto-tuned defaults here so the GUI has something
+// sensible to show before the user tweaks it
+type GPUDevice struct {
+	Index       int  `json:"index"`
+	Intensity   int  `json:"intensity"`
+	Worksize    int  `json:"worksize"`
+	AffineToCPU int  `json:"affine_to_cpu"`
+	Enabled     bool `json:"-"`
+}
+
+// PoolEntry describes a single entry in xmr-stak's pool_list, letting users
+// configure failover pools with weights, pinned TLS fingerprints and
+// NiceHash compatibility
+type PoolEntry struct {
+	Address        string
+	Wallet         string
+	Password       string
+	UseTLS         bool
+	TLSFingerprint string
+	UseNiceHash    bool
+	Weight         int
+	RigID          string
+}
+
+// CPUThreadsConf mirrors the top-level shape of cpu.txt so it can be
+// round-tripped through the jsonc package instead of a template
+type CPUThreadsConf struct {
+	CPUThreadsConf []CPUThreadConf `json:"cpu_threads_conf"`
+}
+
+// CPUThreadConf is a single entry of cpu.txt's cpu_threads_conf list
+type CPUThreadConf struct {
+	LowPowerMode interface{} `json:"low_power_mode"`
+	NoPrefetch   bool        `json:"no_prefetch"`
+	Asm          string      `json:"asm"`
+	AffineToCPU  interface{} `json:"affine_to_cpu"`
+}
+
+// GPUThreadsConf mirrors the top-level shape of amd.txt/nvidia.txt so it
+// can be round-tripped through the jsonc package instead of a template
+type GPUThreadsConf struct {
+	GPUThreadsConf []GPUDevice `json:"gpu_threads_conf"`
+}
+
+// PoolList mirrors the top-level shape of pools.txt so it can be
+// round-tripped through the jsonc package instead of a template
+type PoolList struct {
+	PoolList []PoolListEntry `json:"pool_list"`
+	Currency string          `json:"currency"`
+}
+
+// ThreadStat carries a single thread's reported hashrate samples, as shown
+// by xmr-stak's 'h' report and mirrored in the API's hashrate.threads array
+type ThreadStat struct {
+	ID          int
+	Hashrate10s float64
+	Hashrate60s float64
+	Hashrate15m float64
+}
+
+// StatError is a single deduplicatable entry from xmr-stak's result/connection
+// error logs, e.g. the "Low difficulty share" counter shown in the miner's
+// own 'r' report
+type StatError struct {
+	Count    int
+	LastSeen time.Time
+	Text     string
+	Source   string
+}
+
+// PoolListEntry is a single entry of pools.txt's pool_list list
+type PoolListEntry struct {
+	PoolAddress    string `json:"pool_address"`
+	WalletAddress  string `json:"wallet_address"`
+	RigID          string `json:"rig_id"`
+	PoolPassword   string `json:"pool_password"`
+	UseNiceHash    bool   `json:"use_nicehash"`
+	UseTLS         bool   `json:"use_tls"`
+	TLSFingerprint string `json:"tls_fingerprint"`
+	PoolWeight     int    `json:"pool_weight"`
+}
+
+// defaultGPUDevice returns the auto-tuned defaults xmr-stak itself suggests
+// on first run for a device at the given index
+func defaultGPUDevice(index int) GPUDevice {
+	return GPUDevice{
+		Index:       index,
+		Intensity:   1000,
+		Worksize:    8,
+		AffineToCPU: -1,
+		Enabled:     true,
+	}
 }
 
 // XmrStakResponse contains the data from xmr-stak API
@@ -58,16 +179,24 @@ type XmrStakResponse struct {
 // NewXmrStak creates a new xmr-stak miner instance
 func NewXmrStak(config Config) (*XmrStak, error) {
 
+	httpPort := config.HTTPPort
+	if httpPort == 0 {
+		httpPort = 16000
+	}
+
 	endpoint := config.Endpoint
 	if endpoint == "" {
-		endpoint = "http://127.0.0.1:16000/api.json"
+		endpoint = fmt.Sprintf("http://127.0.0.1:%d/api.json", httpPort)
 	}
 
 	miner := XmrStak{
-		// We've switched back to the original miner XMR-STAK but we will 
+		// We've switched back to the original miner XMR-STAK but we will
 		// keep an eye on it to make sure the compatibility works for future update
-		name:     "xmr-stak",
-		endpoint: endpoint,
+		name:         "xmr-stak",
+		endpoint:     endpoint,
+		httpPort:     httpPort,
+		httpLogin:    config.HTTPLogin,
+		httpPassword: config.HTTPPassword,
 	}
 	miner.Base.executableName = filepath.Base(config.Path)
 	miner.Base.executablePath = filepath.Dir(config.Path)
@@ -77,8 +206,7 @@ func NewXmrStak(config Config) (*XmrStak, error) {
 
 // WriteConfig writes the miner's configuration in the xmr-stak format
 func (miner *XmrStak) WriteConfig(
-	poolEndpoint string,
-	walletAddress string,
+	pools []PoolEntry,
 	coinAlgorithm string,
 	processingConfig ProcessingConfig) error {
 
@@ -94,7 +222,7 @@ func (miner *XmrStak) WriteConfig(
 
 	err = ioutil.WriteFile(
 		filepath.Join(miner.Base.executablePath, "pools.txt"),
-		[]byte(miner.buildPoolConfig(poolEndpoint, walletAddress, coinAlgorithm)),
+		[]byte(miner.buildPoolConfig(pools, coinAlgorithm)),
 		0644)
 	if err != nil {
 		return err
@@ -114,19 +242,159 @@ func (miner *XmrStak) WriteConfig(
 			return err
 		}
 	}
+
+	// GPU mining is only available on builds compiled with OpenCL/CUDA
+	// support, so we probe for each backend before emitting its config file -
+	// writing amd.txt/nvidia.txt for a backend the binary doesn't have would
+	// just confuse it. AMD and NVIDIA each get their own device list so a
+	// binary built with both backends (the default official xmr-stak build)
+	// doesn't write the same device indices into both files and double-count
+	// a single GPU
+	supportsAMD, supportsNVIDIA := miner.probeGPUBackends()
+	miner.supportsGPU = supportsAMD || supportsNVIDIA
+	if miner.supportsGPU {
+		miner.seedGPUDeviceDefaults(supportsAMD, supportsNVIDIA)
+
+		if supportsAMD {
+			err = ioutil.WriteFile(
+				filepath.Join(miner.Base.executablePath, "amd.txt"),
+				[]byte(miner.amdConfig(miner.amdDevices)),
+				0644)
+			if err != nil {
+				return err
+			}
+		}
+		if supportsNVIDIA {
+			err = ioutil.WriteFile(
+				filepath.Join(miner.Base.executablePath, "nvidia.txt"),
+				[]byte(miner.nvidiaConfig(miner.nvidiaDevices)),
+				0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// Reset hashrate
 	miner.lastHashrate = 0.00
 	return nil
 }
 
+// probeGPUBackends checks whether the built xmr-stak binary was compiled
+// with OpenCL and/or CUDA support, so we only manage the config file for a
+// backend the binary actually has. xmr-stak prints "OpenCL" / "CUDA" in its
+// --help banner when a backend is compiled in, and it stubs out the
+// matching amd.txt/nvidia.txt on first run when it does - either signal is
+// good enough to decide
+func (miner *XmrStak) probeGPUBackends() (supportsAMD bool, supportsNVIDIA bool) {
+	if _, err := os.Stat(filepath.Join(miner.Base.executablePath, "amd.txt")); err == nil {
+		supportsAMD = true
+	}
+	if _, err := os.Stat(filepath.Join(miner.Base.executablePath, "nvidia.txt")); err == nil {
+		supportsNVIDIA = true
+	}
+	if supportsAMD || supportsNVIDIA {
+		return supportsAMD, supportsNVIDIA
+	}
+
+	executable := filepath.Join(miner.Base.executablePath, miner.Base.executableName)
+	out, err := exec.Command(executable, "--help").CombinedOutput()
+	if err != nil {
+		return false, false
+	}
+	help := string(out)
+	return strings.Contains(help, "OpenCL"), strings.Contains(help, "CUDA")
+}
+
+// seedGPUDeviceDefaults fills in amdDevices/nvidiaDevices with one
+// auto-tuned entry per real device enumerated through each backend's own
+// tooling, so a binary built with both OpenCL and CUDA support (the default
+// official xmr-stak build) doesn't suggest a device on a backend the user
+// has no hardware for. If neither backend can be enumerated we fall back to
+// a single assumed device on just one backend, rather than guessing one for
+// each and double-counting it
+func (miner *XmrStak) seedGPUDeviceDefaults(supportsAMD bool, supportsNVIDIA bool) {
+	var amdCount, nvidiaCount int
+	if supportsAMD && len(miner.amdDevices) == 0 {
+		amdCount = countOpenCLDevices()
+	}
+	if supportsNVIDIA && len(miner.nvidiaDevices) == 0 {
+		nvidiaCount = countCUDADevices()
+	}
+
+	if supportsAMD && supportsNVIDIA && amdCount == 0 && nvidiaCount == 0 {
+		// Both backends are compiled in but neither tool could enumerate real
+		// hardware. Assume a single device on NVIDIA, the more common mining
+		// backend, and leave AMD empty so we don't invent a second GPU
+		nvidiaCount = 1
+	} else if supportsAMD && !supportsNVIDIA && amdCount == 0 {
+		// Only the AMD backend is compiled in, so there's no ambiguity
+		amdCount = 1
+	} else if supportsNVIDIA && !supportsAMD && nvidiaCount == 0 {
+		// Only the NVIDIA backend is compiled in, so there's no ambiguity
+		nvidiaCount = 1
+	}
+
+	if supportsAMD && len(miner.amdDevices) == 0 && amdCount > 0 {
+		miner.amdDevices = make([]GPUDevice, amdCount)
+		for i := range miner.amdDevices {
+			miner.amdDevices[i] = defaultGPUDevice(i)
+		}
+	}
+	if supportsNVIDIA && len(miner.nvidiaDevices) == 0 && nvidiaCount > 0 {
+		miner.nvidiaDevices = make([]GPUDevice, nvidiaCount)
+		for i := range miner.nvidiaDevices {
+			miner.nvidiaDevices[i] = defaultGPUDevice(i)
+		}
+	}
+}
+
+// countOpenCLDevices shells out to clinfo to count the AMD/OpenCL devices
+// actually installed, returning 0 if clinfo isn't available. Devices listed
+// under a non-AMD OpenCL platform (e.g. NVIDIA's) are not counted
+func countOpenCLDevices() int {
+	out, err := exec.Command("clinfo", "--list").CombinedOutput()
+	if err != nil {
+		return 0
+	}
+	var count int
+	var amdPlatform bool
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "Platform") {
+			amdPlatform = strings.Contains(line, "AMD")
+			continue
+		}
+		if amdPlatform && strings.Contains(line, "Device") {
+			count++
+		}
+	}
+	return count
+}
+
+// countCUDADevices shells out to nvidia-smi to count the NVIDIA/CUDA devices
+// actually installed, returning 0 if nvidia-smi isn't available
+func countCUDADevices() int {
+	out, err := exec.Command("nvidia-smi", "-L").CombinedOutput()
+	if err != nil {
+		return 0
+	}
+	var count int
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
 // GetProcessingConfig returns the current miner processing config
-// TODO: Currently only CPU threads, extend this to full CPU/GPU config
 func (miner *XmrStak) GetProcessingConfig() ProcessingConfig {
 	return ProcessingConfig{
 		MaxUsage: 0,
 		// xmr-stak reports GPU + CPU threads in the same section, for that reason
 		// we need to check the actual cpu.txt file to get the real thread count
 		Threads:    miner.getCPUThreadcount(),
+		GPUThreads: miner.getGPUThreadcount(),
 		MaxThreads: uint16(runtime.NumCPU()),
 		Type:       miner.name,
 	}
@@ -151,39 +419,97 @@ func (miner *XmrStak) getCPUThreadcount() uint16 {
 	if err != nil {
 		return 0
 	}
-	// xmr-stak uses a strange JSON-like format, I haven't found a Go library
-	// that can parse the file, so we're doing some basic string matches
-	lines := strings.Split(string(configFileBytes), "\n")
-	var validLines string
-	for _, line := range lines {
-		for _, char := range line {
-			// This is a very very very basic check if this line is actually a comment
-			if string(char) == "/" || string(char) == "*" {
-				// Skip this line
-				break
-			} else {
-				validLines += string(char)
-			}
-		}
+
+	var conf CPUThreadsConf
+	if err := jsonc.Unmarshal(configFileBytes, &conf); err != nil {
+		return 0
 	}
+	return uint16(len(conf.CPUThreadsConf))
+}
 
+// getGPUThreadcount returns the combined amd.txt/nvidia.txt device count
+func (miner *XmrStak) getGPUThreadcount() uint16 {
 	var threadcount uint16
-	// Match anything enclosed in {} for JSON object
-	var re = regexp.MustCompile(`{*}`)
-	for _ = range re.FindAllString(validLines, -1) {
-		threadcount++
+	for _, name := range []string{"amd.txt", "nvidia.txt"} {
+		configPath := filepath.Join(miner.Base.executablePath, name)
+		configFileBytes, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			continue
+		}
+		var conf GPUThreadsConf
+		if err := jsonc.Unmarshal(configFileBytes, &conf); err != nil {
+			continue
+		}
+		threadcount += uint16(len(conf.GPUThreadsConf))
 	}
 	return threadcount
 }
 
+// SetCPUThreadLowPowerMode mutates a single thread's low_power_mode in
+// cpu.txt in place, round-tripping the rest of the file through the jsonc
+// package instead of regenerating every thread's settings from the template
+func (miner *XmrStak) SetCPUThreadLowPowerMode(threadIndex int, lowPowerMode bool) error {
+	configPath := filepath.Join(miner.Base.executablePath, "cpu.txt")
+	configFileBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var conf CPUThreadsConf
+	if err := jsonc.Unmarshal(configFileBytes, &conf); err != nil {
+		return err
+	}
+	if threadIndex < 0 || threadIndex >= len(conf.CPUThreadsConf) {
+		return fmt.Errorf("xmr-stak: no cpu thread at index %d", threadIndex)
+	}
+	conf.CPUThreadsConf[threadIndex].LowPowerMode = lowPowerMode
+
+	updated, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return err
+	}
+	// cpu.txt holds bare top-level keys, so drop the enclosing {} again
+	updated = updated[1 : len(updated)-1]
+	return ioutil.WriteFile(configPath, updated, 0644)
+}
+
+// SetPoolTLS mutates a single pool's use_tls in pools.txt in place,
+// round-tripping the rest of the file through the jsonc package instead of
+// regenerating every pool entry from the template
+func (miner *XmrStak) SetPoolTLS(poolIndex int, useTLS bool) error {
+	configPath := filepath.Join(miner.Base.executablePath, "pools.txt")
+	configFileBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var list PoolList
+	if err := jsonc.Unmarshal(configFileBytes, &list); err != nil {
+		return err
+	}
+	if poolIndex < 0 || poolIndex >= len(list.PoolList) {
+		return fmt.Errorf("xmr-stak: no pool at index %d", poolIndex)
+	}
+	list.PoolList[poolIndex].UseTLS = useTLS
+
+	updated, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+	// pools.txt holds bare top-level keys, so drop the enclosing {} again
+	updated = updated[1 : len(updated)-1]
+	return ioutil.WriteFile(configPath, updated, 0644)
+}
+
 // GetStats returns the current miner stats
 func (miner *XmrStak) GetStats() (Stats, error) {
 	var stats Stats
 	var xmrStats XmrStakResponse
-	resp, err := http.Get(miner.endpoint)
+	resp, err := miner.fetchAPI()
 	if err != nil {
 		return stats, err
 	}
+	defer resp.Body.Close()
 	err = json.NewDecoder(resp.Body).Decode(&xmrStats)
 	if err != nil {
 		return stats, err
@@ -195,21 +521,37 @@ func (miner *XmrStak) GetStats() (Stats, error) {
 	}
 	miner.lastHashrate = hashrate
 
-	var errors []string
-	if len(xmrStats.Connection.ErrorLog) > 0 {
-		for _, err := range xmrStats.Connection.ErrorLog {
-			errors = append(errors, fmt.Sprintf("%s",
-				err.Text,
-			))
-		}
+	var perThread []ThreadStat
+	for id, thread := range xmrStats.Hashrate.Threads {
+		perThread = append(perThread, ThreadStat{
+			ID:          id,
+			Hashrate10s: threadHashrateSample(thread, 0),
+			Hashrate60s: threadHashrateSample(thread, 1),
+			Hashrate15m: threadHashrateSample(thread, 2),
+		})
 	}
-	if len(xmrStats.Results.ErrorLog) > 0 {
-		for _, err := range xmrStats.Results.ErrorLog {
-			errors = append(errors, fmt.Sprintf("(%d) %s",
-				err.Count,
-				err.Text,
-			))
-		}
+
+	var errors []StatError
+	for _, err := range xmrStats.Connection.ErrorLog {
+		errors = append(errors, StatError{
+			Count:    1,
+			LastSeen: time.Unix(int64(err.LastSeen), 0),
+			Text:     err.Text,
+			Source:   "connection",
+		})
+	}
+	for _, err := range xmrStats.Results.ErrorLog {
+		errors = append(errors, StatError{
+			Count:    err.Count,
+			LastSeen: time.Unix(int64(err.LastSeen), 0),
+			Text:     err.Text,
+			Source:   "result",
+		})
+	}
+
+	var bestShare int
+	if len(xmrStats.Results.Best) > 0 {
+		bestShare = xmrStats.Results.Best[0]
 	}
 
 	stats = Stats{
@@ -220,12 +562,169 @@ func (miner *XmrStak) GetStats() (Stats, error) {
 		UptimeHuman:       HumanizeTime(xmrStats.Connection.Uptime),
 		SharesGood:        xmrStats.Results.SharesGood,
 		SharesBad:         xmrStats.Results.SharesTotal - xmrStats.Results.SharesGood,
+		PerThread:         perThread,
+		HighestHashrate:   xmrStats.Hashrate.Highest,
+		AvgBlockTime:      xmrStats.Results.AvgTime,
+		TotalHashes:       xmrStats.Results.HashesTotal,
+		BestShare:         bestShare,
 		Errors:            errors,
 	}
 	miner.resultStatsCache = xmrStats
 	return stats, nil
 }
 
+// threadHashrateSample safely reads the sample at index from a single
+// thread's hashrate row, returning 0 when xmr-stak hasn't reported it yet
+// (e.g. the 15m average during the first 15 minutes)
+func threadHashrateSample(thread []interface{}, index int) float64 {
+	if index >= len(thread) {
+		return 0
+	}
+	sample, ok := thread[index].(float64)
+	if !ok {
+		return 0
+	}
+	return sample
+}
+
+// fetchAPI retrieves the xmr-stak API endpoint, performing HTTP Digest
+// authentication (RFC 2617, MD5) when http_login/http_pass are configured.
+// The challenge is cached after the first exchange so later polls can send
+// an authenticated request straight away instead of round-tripping twice
+func (miner *XmrStak) fetchAPI() (*http.Response, error) {
+	if miner.httpLogin == "" {
+		return http.Get(miner.endpoint)
+	}
+
+	if miner.digest != nil {
+		resp, err := miner.doDigestRequest()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(miner.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	challenge, err := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	miner.digest = challenge
+	return miner.doDigestRequest()
+}
+
+// doDigestRequest sends a GET request to the API endpoint with an
+// Authorization header built from the cached digest challenge
+func (miner *XmrStak) doDigestRequest() (*http.Response, error) {
+	req, err := http.NewRequest("GET", miner.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	// xmr-stak's httpd (libmicrohttpd) validates the digest "uri" field and
+	// computes HA2 against the request-URI path, not the full URL - sending
+	// the full URL here makes every authenticated poll fail with a 401
+	parsed, err := url.Parse(miner.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	digestURI := parsed.RequestURI()
+
+	req.Header.Set("Authorization", miner.digest.authorizationHeader(miner.httpLogin, miner.httpPassword, digestURI))
+	return http.DefaultClient.Do(req)
+}
+
+// parseDigestChallenge extracts realm/nonce/qop from a WWW-Authenticate
+// Digest header
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	if !strings.HasPrefix(header, "Digest ") {
+		return nil, fmt.Errorf("xmr-stak: unsupported auth challenge %q", header)
+	}
+	challenge := &digestChallenge{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, "Digest "), ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := parts[0]
+		value := strings.Trim(parts[1], `"`)
+		switch key {
+		case "realm":
+			challenge.realm = value
+		case "nonce":
+			challenge.nonce = value
+		case "qop":
+			challenge.qop = strings.Split(value, ",")[0]
+		}
+	}
+	if challenge.nonce == "" {
+		return nil, fmt.Errorf("xmr-stak: auth challenge missing nonce")
+	}
+	return challenge, nil
+}
+
+// authorizationHeader builds the Authorization request header for a GET to
+// uri, incrementing the cached nonce count on every call as RFC 2617 requires
+func (challenge *digestChallenge) authorizationHeader(login string, password string, uri string) string {
+	challenge.nc++
+	cnonce := randomHex(8)
+	nc := fmt.Sprintf("%08x", challenge.nc)
+
+	ha1 := md5Hex(login + ":" + challenge.realm + ":" + password)
+	ha2 := md5Hex("GET:" + uri)
+
+	var response string
+	if challenge.qop != "" {
+		response = md5Hex(strings.Join([]string{ha1, challenge.nonce, nc, cnonce, challenge.qop, ha2}, ":"))
+	} else {
+		response = md5Hex(strings.Join([]string{ha1, challenge.nonce, ha2}, ":"))
+	}
+
+	header := fmt.Sprintf(
+		`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		login, challenge.realm, challenge.nonce, uri, response)
+	if challenge.qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, challenge.qop, nc, cnonce)
+	}
+	return header
+}
+
+// md5Hex returns the hex-encoded MD5 sum of s, as used throughout RFC 2617
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes hex-encoded, used as the client nonce
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// jsonString returns s encoded as a quoted JSON string literal, so
+// user-supplied values (e.g. http_login/http_pass) can't break the
+// hand-written config templates by embedding a stray quote or backslash
+func jsonString(s string) string {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return string(encoded)
+}
+
 // defaultConfig returns the base xmr-stak config
 // xmr-stak uses a JSON format that doesn't have a compatible Go
 // parser which is why I'm doing this as text or templates
@@ -370,7 +869,7 @@ func (miner *XmrStak) defaultConfig() string {
 	 *
 	 * httpd_port - Port we should listen on. Default, 0, will switch off the server.
 	 */
-	"httpd_port" : 16000,
+	"httpd_port" : ` + strconv.Itoa(miner.httpPort) + `,
 
 	/*
 	 * HTTP Authentication
@@ -382,8 +881,8 @@ func (miner *XmrStak) defaultConfig() string {
 	 * http_login - Login. Empty login disables authentication.
 	 * http_pass  - Password.
 	 */
-	"http_login" : "",
-	"http_pass" : "",
+	"http_login" : ` + jsonString(miner.httpLogin) + `,
+	"http_pass" : ` + jsonString(miner.httpPassword) + `,
 
 	/*
 	 * prefer_ipv4 - IPv6 preference. If the host is available on both IPv4 and IPv6 net, which one should be choose?
@@ -393,19 +892,31 @@ func (miner *XmrStak) defaultConfig() string {
 	`
 }
 
-// buildPoolConfig returns the XmrStak pool config to be written to file
+// buildPoolConfig returns the XmrStak pool config to be written to file.
+// Supports multiple failover pools, each with its own weight, TLS and
+// NiceHash settings, matching xmr-stak's pool_list behaviour
 // xmr-stak uses a JSON format that doesn't have a compatible Go
 // parser which is why I'm doing this as text or templates
 func (miner *XmrStak) buildPoolConfig(
-	poolEndpoint string,
-	walletAddress string,
+	pools []PoolEntry,
 	coinAlgorithm string) string {
 
+	var poolList string
+	for _, pool := range pools {
+		password := pool.Password
+		if password == "" {
+			password = "BLOC GUI Miner"
+		}
+		poolList += fmt.Sprintf(
+			"\t{\"pool_address\" : %s, \"wallet_address\" : %s, \"rig_id\" : %s, \"pool_password\" : %s, \"use_nicehash\" : %t, \"use_tls\" : %t, \"tls_fingerprint\" : %s, \"pool_weight\" : %d },\n",
+			jsonString(pool.Address), jsonString(pool.Wallet), jsonString(pool.RigID), jsonString(password),
+			pool.UseNiceHash, pool.UseTLS, jsonString(pool.TLSFingerprint), pool.Weight)
+	}
+
 	return `
 "pool_list" :
 [
-	{"pool_address" : "` + poolEndpoint + `", "wallet_address" : "` + walletAddress + `", "rig_id" : "", "pool_password" : "BLOC GUI Miner", "use_nicehash" : false, "use_tls" : false, "tls_fingerprint" : "", "pool_weight" : 1 },
-],
+` + poolList + `],
 "currency" : "` + coinAlgorithm + `",
 		`
 }
@@ -458,3 +969,61 @@ func (miner *XmrStak) cpuConfig(threads uint16) string {
 	],
 `
 }
+
+// amdConfig returns the XmrStak AMD/OpenCL GPU config to be written to
+// amd.txt based on the detected devices
+// The jsonc package only reads this format, so the file is written from a
+// text template
+func (miner *XmrStak) amdConfig(devices []GPUDevice) string {
+	return `
+	/*
+	 * GPU configuration. index, intensity and worksize must be set per-device,
+	 * use the OpenCL platform/device index as reported by the miner on first run.
+	 *
+	 * On the first run the miner will look at your GPUs and suggest a basic
+	 * configuration that will work, you can try to tweak it from there to get
+	 * the best performance.
+	 */
+	"gpu_threads_conf" :
+	[
+` + gpuDeviceThreadsConfig(devices) + `
+	],
+	"platform_index" : 0,
+`
+}
+
+// nvidiaConfig returns the XmrStak NVIDIA/CUDA GPU config to be written to
+// nvidia.txt based on the detected devices
+// The jsonc package only reads this format, so the file is written from a
+// text template
+func (miner *XmrStak) nvidiaConfig(devices []GPUDevice) string {
+	return `
+	/*
+	 * GPU configuration. index is the CUDA device index, intensity and
+	 * worksize must be set per-device.
+	 *
+	 * On the first run the miner will look at your GPUs and suggest a basic
+	 * configuration that will work, you can try to tweak it from there to get
+	 * the best performance.
+	 */
+	"gpu_threads_conf" :
+	[
+` + gpuDeviceThreadsConfig(devices) + `
+	],
+`
+}
+
+// gpuDeviceThreadsConfig renders a slice of GPUDevice as the repeated
+// gpu_threads_conf entries shared by amd.txt and nvidia.txt
+func gpuDeviceThreadsConfig(devices []GPUDevice) string {
+	var threadsConfig string
+	for _, device := range devices {
+		if !device.Enabled {
+			continue
+		}
+		threadsConfig += fmt.Sprintf(
+			"{ \"index\" : %d, \"intensity\" : %d, \"worksize\" : %d, \"affine_to_cpu\" : %d, \"strided_index\" : true, \"mem_chunk\" : 2, \"comp_mode\" : true },",
+			device.Index, device.Intensity, device.Worksize, device.AffineToCPU)
+	}
+	return threadsConfig
+}
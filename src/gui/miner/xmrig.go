@@ -0,0 +1,263 @@
+package miner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// XMRig implements the miner interface for the XMRig miner
+// https://github.com/xmrig/xmrig
+type XMRig struct {
+	Base
+	name             string
+	endpoint         string
+	lastHashrate     float64
+	resultStatsCache XMRigResponse
+}
+
+// XMRigResponse contains the data from XMRig's HTTP API (the /2/summary
+// endpoint). XMRig's API was modelled on xmr-stak's, so the shape below
+// mirrors XmrStakResponse closely
+// Generated with https://mholt.github.io/json-to-go/
+type XMRigResponse struct {
+	Version  string `json:"version"`
+	Hashrate struct {
+		Total   []float64       `json:"total"`
+		Highest float64         `json:"highest"`
+		Threads [][]interface{} `json:"threads"`
+	} `json:"hashrate"`
+	Results struct {
+		DiffCurrent int64   `json:"diff_current"`
+		SharesGood  int     `json:"shares_good"`
+		SharesTotal int     `json:"shares_total"`
+		AvgTime     float64 `json:"avg_time"`
+		HashesTotal int     `json:"hashes_total"`
+		Best        []int   `json:"best"`
+		ErrorLog    []struct {
+			LastSeen int    `json:"last_seen"`
+			Text     string `json:"text"`
+		} `json:"error_log"`
+	} `json:"results"`
+	Connection struct {
+		Pool     string `json:"pool"`
+		Uptime   int    `json:"uptime"`
+		Ping     int    `json:"ping"`
+		ErrorLog []struct {
+			LastSeen int    `json:"last_seen"`
+			Text     string `json:"text"`
+		} `json:"error_log"`
+	} `json:"connection"`
+	CPU struct {
+		Threads int `json:"threads"`
+	} `json:"cpu"`
+}
+
+// xmrigConfig mirrors the subset of XMRig's config.json we write out.
+// Unlike xmr-stak's commented pseudo-JSON, XMRig's config is plain JSON, so
+// we can marshal it directly instead of building it from string templates
+type xmrigConfig struct {
+	Pools       []xmrigPoolConfig `json:"pools"`
+	CPU         xmrigCPUConfig    `json:"cpu"`
+	Algo        string            `json:"algo,omitempty"`
+	DonateLevel int               `json:"donate-level"`
+}
+
+// xmrigPoolConfig is a single entry of config.json's pools list
+type xmrigPoolConfig struct {
+	URL            string `json:"url"`
+	User           string `json:"user"`
+	Pass           string `json:"pass"`
+	RigID          string `json:"rig-id,omitempty"`
+	Nicehash       bool   `json:"nicehash,omitempty"`
+	TLS            bool   `json:"tls,omitempty"`
+	TLSFingerprint string `json:"tls-fingerprint,omitempty"`
+	KeepAlive      bool   `json:"keepalive"`
+}
+
+// xmrigCPUConfig is config.json's cpu block
+type xmrigCPUConfig struct {
+	Enabled bool  `json:"enabled"`
+	Threads int   `json:"threads"`
+	Affine  []int `json:"affinity,omitempty"`
+}
+
+// NewXMRig creates a new XMRig miner instance
+func NewXMRig(config Config) (*XMRig, error) {
+
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:16000/2/summary"
+	}
+
+	miner := XMRig{
+		name:     "xmrig",
+		endpoint: endpoint,
+	}
+	miner.Base.executableName = filepath.Base(config.Path)
+	miner.Base.executablePath = filepath.Dir(config.Path)
+
+	return &miner, nil
+}
+
+// WriteConfig writes the miner's configuration in the XMRig format
+func (miner *XMRig) WriteConfig(
+	pools []PoolEntry,
+	coinAlgorithm string,
+	processingConfig ProcessingConfig) error {
+
+	var poolConfigs []xmrigPoolConfig
+	for _, pool := range pools {
+		poolConfigs = append(poolConfigs, xmrigPoolConfig{
+			URL:            pool.Address,
+			User:           pool.Wallet,
+			Pass:           pool.Password,
+			RigID:          pool.RigID,
+			Nicehash:       pool.UseNiceHash,
+			TLS:            pool.UseTLS,
+			TLSFingerprint: pool.TLSFingerprint,
+			KeepAlive:      true,
+		})
+	}
+
+	config := xmrigConfig{
+		Pools: poolConfigs,
+		CPU: xmrigCPUConfig{
+			Enabled: processingConfig.Threads > 0,
+			Threads: int(processingConfig.Threads),
+		},
+		Algo:        coinAlgorithm,
+		DonateLevel: 0,
+	}
+
+	configBytes, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(
+		filepath.Join(miner.Base.executablePath, "config.json"),
+		configBytes,
+		0644)
+	if err != nil {
+		return err
+	}
+
+	// Reset hashrate
+	miner.lastHashrate = 0.00
+	return nil
+}
+
+// GetProcessingConfig returns the current miner processing config
+func (miner *XMRig) GetProcessingConfig() ProcessingConfig {
+	return ProcessingConfig{
+		MaxUsage:   0,
+		Threads:    miner.getCPUThreadcount(),
+		MaxThreads: uint16(0),
+		Type:       miner.name,
+	}
+}
+
+// GetName returns the name of the miner
+func (miner *XMRig) GetName() string {
+	return miner.name
+}
+
+// GetLastHashrate returns the last reported hashrate
+func (miner *XMRig) GetLastHashrate() float64 {
+	return miner.lastHashrate
+}
+
+// getCPUThreadcount returns the threads used for the CPU as read from the
+// config
+func (miner *XMRig) getCPUThreadcount() uint16 {
+	configPath := filepath.Join(miner.Base.executablePath, "config.json")
+	configFileBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return 0
+	}
+
+	var config struct {
+		CPU struct {
+			Threads int `json:"threads"`
+		} `json:"cpu"`
+	}
+	if err := json.Unmarshal(configFileBytes, &config); err != nil {
+		return 0
+	}
+	return uint16(config.CPU.Threads)
+}
+
+// GetStats returns the current miner stats
+func (miner *XMRig) GetStats() (Stats, error) {
+	var stats Stats
+	var xmrigStats XMRigResponse
+	resp, err := http.Get(miner.endpoint)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&xmrigStats)
+	if err != nil {
+		return stats, err
+	}
+
+	var hashrate float64
+	if len(xmrigStats.Hashrate.Total) > 0 {
+		hashrate = xmrigStats.Hashrate.Total[0]
+	}
+	miner.lastHashrate = hashrate
+
+	var perThread []ThreadStat
+	for id, thread := range xmrigStats.Hashrate.Threads {
+		perThread = append(perThread, ThreadStat{
+			ID:          id,
+			Hashrate10s: threadHashrateSample(thread, 0),
+			Hashrate60s: threadHashrateSample(thread, 1),
+			Hashrate15m: threadHashrateSample(thread, 2),
+		})
+	}
+
+	var errors []StatError
+	for _, err := range xmrigStats.Connection.ErrorLog {
+		errors = append(errors, StatError{
+			Count:    1,
+			LastSeen: time.Unix(int64(err.LastSeen), 0),
+			Text:     err.Text,
+			Source:   "connection",
+		})
+	}
+	for _, err := range xmrigStats.Results.ErrorLog {
+		errors = append(errors, StatError{
+			Count:    1,
+			LastSeen: time.Unix(int64(err.LastSeen), 0),
+			Text:     err.Text,
+			Source:   "result",
+		})
+	}
+
+	var bestShare int
+	if len(xmrigStats.Results.Best) > 0 {
+		bestShare = xmrigStats.Results.Best[0]
+	}
+
+	stats = Stats{
+		Hashrate:          hashrate,
+		HashrateHuman:     HumanizeHashrate(hashrate),
+		CurrentDifficulty: xmrigStats.Results.DiffCurrent,
+		Uptime:            xmrigStats.Connection.Uptime,
+		UptimeHuman:       HumanizeTime(xmrigStats.Connection.Uptime),
+		SharesGood:        xmrigStats.Results.SharesGood,
+		SharesBad:         xmrigStats.Results.SharesTotal - xmrigStats.Results.SharesGood,
+		PerThread:         perThread,
+		HighestHashrate:   xmrigStats.Hashrate.Highest,
+		AvgBlockTime:      xmrigStats.Results.AvgTime,
+		TotalHashes:       xmrigStats.Results.HashesTotal,
+		BestShare:         bestShare,
+		Errors:            errors,
+	}
+	miner.resultStatsCache = xmrigStats
+	return stats, nil
+}